@@ -0,0 +1,124 @@
+package imagedownloader
+
+import (
+	"sync"
+
+	"github.com/tschwemley/imagedownloader/progress"
+)
+
+// EventType identifies the kind of lifecycle Event emitted for a download.
+type EventType int
+
+const (
+	EventStarted EventType = iota
+	EventProgress
+	EventRetrying
+	EventCompleted
+	EventFailed
+)
+
+// Event is a single download lifecycle notification published on an
+// ImageDownloader's broadcast relay. Which fields are populated depends on
+// Type: Progress sets Bytes/Total, Retrying sets Attempt/Err, Completed sets
+// Result, and Failed sets Err.
+type Event struct {
+	Type    EventType
+	URL     string
+	Bytes   int64
+	Total   int64
+	Attempt int
+	Err     error
+	Result  ImageDownloadResult
+}
+
+// relay is a minimal generic broadcast relay: published values are fanned out
+// to every currently subscribed channel, dropping the value for any
+// subscriber that isn't keeping up. Modeled on the broadcast.Relay type used
+// in the Redmage patch.
+type relay[T any] struct {
+	mu   sync.Mutex
+	subs map[chan T]struct{}
+}
+
+func newRelay[T any]() *relay[T] {
+	return &relay[T]{subs: make(map[chan T]struct{})}
+}
+
+func (r *relay[T]) subscribe() <-chan T {
+	ch := make(chan T, 16)
+	r.mu.Lock()
+	r.subs[ch] = struct{}{}
+	r.mu.Unlock()
+	return ch
+}
+
+func (r *relay[T]) unsubscribe(ch <-chan T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.subs {
+		if c == ch {
+			delete(r.subs, c)
+			close(c)
+			return
+		}
+	}
+}
+
+func (r *relay[T]) publish(v T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.subs {
+		select {
+		case c <- v:
+		default:
+		}
+	}
+}
+
+// relay lazily initializes and returns id's event relay so that an
+// ImageDownloader built as a struct literal still works.
+func (id *ImageDownloader) relay() *relay[Event] {
+	id.eventsOnce.Do(func() { id.events = newRelay[Event]() })
+	return id.events
+}
+
+func (id *ImageDownloader) emit(evt Event) {
+	id.relay().publish(evt)
+}
+
+// Subscribe returns a channel that receives lifecycle Events for every
+// download this ImageDownloader performs. The channel is buffered but not
+// unbounded: a slow subscriber misses events rather than blocking downloads.
+// Callers must Unsubscribe when finished to release the channel.
+func (id *ImageDownloader) Subscribe() <-chan Event {
+	return id.relay().subscribe()
+}
+
+// Unsubscribe detaches a channel previously returned by Subscribe.
+func (id *ImageDownloader) Unsubscribe(ch <-chan Event) {
+	id.relay().unsubscribe(ch)
+}
+
+// eventProgress adapts an ImageDownloader's event relay to a
+// progress.ProgressOutput so byte-level reads are published as Progress events.
+type eventProgress struct {
+	id  *ImageDownloader
+	url string
+}
+
+func (e eventProgress) WriteProgress(p progress.Progress) error {
+	e.id.emit(Event{Type: EventProgress, URL: e.url, Bytes: p.Current, Total: p.Total})
+	return nil
+}
+
+// fanOutProgress forwards each Progress update to every non-nil out.
+type fanOutProgress []progress.ProgressOutput
+
+func (f fanOutProgress) WriteProgress(p progress.Progress) error {
+	for _, out := range f {
+		if out != nil {
+			out.WriteProgress(p)
+		}
+	}
+	return nil
+}
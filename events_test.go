@@ -0,0 +1,79 @@
+package imagedownloader
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestRelaySubscribePublishUnsubscribe(t *testing.T) {
+	r := newRelay[int]()
+
+	ch := r.subscribe()
+	r.publish(1)
+	r.publish(2)
+
+	if got := <-ch; got != 1 {
+		t.Fatalf("got %d, want 1", got)
+	}
+	if got := <-ch; got != 2 {
+		t.Fatalf("got %d, want 2", got)
+	}
+
+	r.unsubscribe(ch)
+	if _, ok := <-ch; ok {
+		t.Fatal("expected channel to be closed after unsubscribe")
+	}
+
+	// publishing after the only subscriber left must not panic or block.
+	r.publish(3)
+}
+
+func TestRelayDropsValuesForSlowSubscriber(t *testing.T) {
+	r := newRelay[int]()
+	ch := r.subscribe()
+
+	for i := 0; i < 100; i++ {
+		r.publish(i)
+	}
+
+	if len(ch) != cap(ch) {
+		t.Fatalf("buffered channel has %d values, want it full at %d", len(ch), cap(ch))
+	}
+}
+
+func TestRelayConcurrentPublishSubscribeUnsubscribe(t *testing.T) {
+	r := newRelay[int]()
+
+	const subscribers = 8
+	chans := make([]<-chan int, subscribers)
+	for i := range chans {
+		chans[i] = r.subscribe()
+	}
+
+	var wg sync.WaitGroup
+	const publishers = 8
+	const publishesEach = 200
+
+	wg.Add(publishers)
+	for i := 0; i < publishers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < publishesEach; j++ {
+				r.publish(j)
+			}
+		}()
+	}
+
+	wg.Add(subscribers)
+	for _, ch := range chans {
+		go func(ch <-chan int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				<-ch
+			}
+			r.unsubscribe(ch)
+		}(ch)
+	}
+
+	wg.Wait()
+}
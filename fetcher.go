@@ -0,0 +1,176 @@
+package imagedownloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Fetcher retrieves the raw bytes for one ImageDetails, e.g. over HTTP, from
+// disk, or from object storage. The returned Header is consulted for
+// Content-Length when available, so implementations that don't have one can
+// leave it nil or empty. Callers must Close the returned ReadCloser.
+type Fetcher interface {
+	Fetch(ctx context.Context, details ImageDetails) (io.ReadCloser, http.Header, error)
+}
+
+// fetchError wraps a Fetcher error with whether it's safe to retry.
+type fetchError struct {
+	err       error
+	retryable bool
+}
+
+func (e *fetchError) Error() string { return e.err.Error() }
+func (e *fetchError) Unwrap() error { return e.err }
+
+// isFetchRetryable reports whether err, or an error it wraps, was marked
+// retryable by a Fetcher.
+func isFetchRetryable(err error) bool {
+	var fe *fetchError
+	return errors.As(err, &fe) && fe.retryable
+}
+
+// fetcherFor resolves the Fetcher to use for details: its own Fetcher
+// override if set, otherwise the one registered in id.Fetchers for the URL's
+// scheme, falling back to the built-in registry.
+func (id *ImageDownloader) fetcherFor(details ImageDetails) (Fetcher, error) {
+	if details.Fetcher != nil {
+		return details.Fetcher, nil
+	}
+
+	u, err := url.Parse(details.URL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing url: %v", err)
+	}
+
+	if f, ok := id.Fetchers[u.Scheme]; ok {
+		return f, nil
+	}
+	if f, ok := id.defaultFetchers()[u.Scheme]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("no fetcher registered for scheme %q", u.Scheme)
+}
+
+// defaultFetchers returns the ImageDownloader's built-in scheme fetchers,
+// building them lazily so the HTTP fetcher can reuse the shared HTTPClient.
+func (id *ImageDownloader) defaultFetchers() map[string]Fetcher {
+	id.fetchersOnce.Do(func() {
+		id.defaultFetch = map[string]Fetcher{
+			"http":  &httpFetcher{downloader: id},
+			"https": &httpFetcher{downloader: id},
+			"file":  fileFetcher{},
+			"data":  dataFetcher{},
+			"s3":    &S3Fetcher{},
+		}
+	})
+	return id.defaultFetch
+}
+
+// httpFetcher fetches images over plain HTTP(S), reusing the
+// ImageDownloader's pooled HTTPClient and retryable-status classification.
+type httpFetcher struct {
+	downloader *ImageDownloader
+}
+
+func (f *httpFetcher) Fetch(ctx context.Context, details ImageDetails) (io.ReadCloser, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, details.URL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building request: %v", err)
+	}
+
+	resp, err := f.downloader.httpClient().Do(req)
+	if err != nil {
+		return nil, nil, &fetchError{err: fmt.Errorf("error downloading image: %v", err), retryable: true}
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		statusErr := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, nil, &fetchError{
+			err:       retryAfterError{err: statusErr, header: resp.Header.Get("Retry-After")},
+			retryable: f.downloader.isRetryableStatus(resp.StatusCode),
+		}
+	}
+
+	return resp.Body, resp.Header, nil
+}
+
+// fileFetcher fetches images from the local filesystem via file:// URLs.
+type fileFetcher struct{}
+
+func (fileFetcher) Fetch(_ context.Context, details ImageDetails) (io.ReadCloser, http.Header, error) {
+	u, err := url.Parse(details.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error parsing url: %v", err)
+	}
+
+	f, err := os.Open(u.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening file: %v", err)
+	}
+
+	header := http.Header{}
+	if info, err := f.Stat(); err == nil {
+		header.Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	return f, header, nil
+}
+
+// dataFetcher decodes images embedded directly in the URL as a data: URI,
+// e.g. "data:image/png;base64,...".
+type dataFetcher struct{}
+
+func (dataFetcher) Fetch(_ context.Context, details ImageDetails) (io.ReadCloser, http.Header, error) {
+	contentType, data, err := parseDataURI(details.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("Content-Length", strconv.Itoa(len(data)))
+	return io.NopCloser(bytes.NewReader(data)), header, nil
+}
+
+// parseDataURI decodes a "data:[<mediatype>][;base64],<data>" URI.
+func parseDataURI(raw string) (contentType string, data []byte, err error) {
+	const prefix = "data:"
+	if !strings.HasPrefix(raw, prefix) {
+		return "", nil, fmt.Errorf("not a data uri: %s", raw)
+	}
+	rest := raw[len(prefix):]
+
+	comma := strings.IndexByte(rest, ',')
+	if comma < 0 {
+		return "", nil, fmt.Errorf("malformed data uri: missing comma")
+	}
+	meta, payload := rest[:comma], rest[comma+1:]
+
+	base64Encoded := strings.HasSuffix(meta, ";base64")
+	contentType = strings.TrimSuffix(meta, ";base64")
+
+	if base64Encoded {
+		data, err = base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("error decoding base64 data uri: %v", err)
+		}
+		return contentType, data, nil
+	}
+
+	decoded, err := url.QueryUnescape(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("error decoding data uri: %v", err)
+	}
+	return contentType, []byte(decoded), nil
+}
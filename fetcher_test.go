@@ -0,0 +1,93 @@
+package imagedownloader
+
+import (
+	"testing"
+)
+
+func TestParseDataURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		uri      string
+		wantType string
+		wantData string
+		wantErr  bool
+	}{
+		{
+			name:     "base64",
+			uri:      "data:text/plain;base64,aGVsbG8=",
+			wantType: "text/plain",
+			wantData: "hello",
+		},
+		{
+			name:     "plain percent-encoded",
+			uri:      "data:text/plain,hello%20world",
+			wantType: "text/plain",
+			wantData: "hello world",
+		},
+		{
+			name:     "no media type",
+			uri:      "data:,hello",
+			wantType: "",
+			wantData: "hello",
+		},
+		{name: "missing comma", uri: "data:text/plain;base64", wantErr: true},
+		{name: "not a data uri", uri: "https://example.com/image.png", wantErr: true},
+		{name: "invalid base64", uri: "data:image/png;base64,!!!", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType, data, err := parseDataURI(tt.uri)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseDataURI(%q) expected error, got none", tt.uri)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDataURI(%q) unexpected error: %v", tt.uri, err)
+			}
+			if contentType != tt.wantType {
+				t.Errorf("contentType = %q, want %q", contentType, tt.wantType)
+			}
+			if string(data) != tt.wantData {
+				t.Errorf("data = %q, want %q", data, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestParseS3URL(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawURL     string
+		wantBucket string
+		wantKey    string
+		wantErr    bool
+	}{
+		{name: "bucket and key", rawURL: "s3://my-bucket/path/to/image.jpg", wantBucket: "my-bucket", wantKey: "path/to/image.jpg"},
+		{name: "nested key", rawURL: "s3://my-bucket/a/b/c.png", wantBucket: "my-bucket", wantKey: "a/b/c.png"},
+		{name: "wrong scheme", rawURL: "https://my-bucket/image.jpg", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, key, err := parseS3URL(tt.rawURL)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseS3URL(%q) expected error, got none", tt.rawURL)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseS3URL(%q) unexpected error: %v", tt.rawURL, err)
+			}
+			if bucket != tt.wantBucket {
+				t.Errorf("bucket = %q, want %q", bucket, tt.wantBucket)
+			}
+			if key != tt.wantKey {
+				t.Errorf("key = %q, want %q", key, tt.wantKey)
+			}
+		})
+	}
+}
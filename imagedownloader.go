@@ -1,23 +1,92 @@
 package imagedownloader
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/tschwemley/imagedownloader/progress"
 	_ "golang.org/x/image/webp"
 )
 
+// defaultRetryableStatus are the HTTP status codes that are retried by
+// default when no RetryableStatus is configured.
+var defaultRetryableStatus = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
 // ImageDownloader is a service for downloading images
 type ImageDownloader struct {
 	DestinationFolder string
 	Concurrency       int
+
+	// MaxRetries is the number of additional attempts made after a transient
+	// failure before giving up. A value of 0 disables retries.
+	MaxRetries int
+	// BaseBackoff is the delay before the first retry. It doubles on each
+	// subsequent attempt (with jitter) up to MaxBackoff.
+	BaseBackoff time.Duration
+	// MaxBackoff caps the exponential backoff delay between retries. A delay
+	// taken from a server's Retry-After header is used as-is, not capped.
+	MaxBackoff time.Duration
+	// RetryableStatus lists the HTTP status codes that should be retried.
+	// Defaults to 429, 500, 502, 503 and 504 when left nil.
+	RetryableStatus []int
+
+	// ProgressOutput, if set, receives per-file byte counts and status
+	// transitions ("Downloading", "Verifying", "Complete") as downloads
+	// progress.
+	ProgressOutput progress.ProgressOutput
+
+	// HTTPClient is reused across every download so that connections are
+	// pooled instead of dialed fresh each time. If left nil, a client is
+	// built lazily from DialTimeout and MaxIdleConnsPerHost.
+	HTTPClient *http.Client
+	// DialTimeout bounds how long the default HTTPClient's Transport waits to
+	// establish a connection. Ignored if HTTPClient is set.
+	DialTimeout time.Duration
+	// MaxIdleConnsPerHost bounds the default HTTPClient's connection pool
+	// size per host. Ignored if HTTPClient is set.
+	MaxIdleConnsPerHost int
+
+	// Store is the content-addressed metadata store backing downloads to
+	// DestinationFolder. It's opened lazily from "metadata.json" in
+	// DestinationFolder the first time it's needed unless set beforehand.
+	Store *Store
+
+	// Fetchers overrides the built-in Fetcher registered for a URL scheme
+	// (e.g. "s3", "file"), or adds support for a new one. Schemes not present
+	// here fall back to the built-in registry. An individual ImageDetails can
+	// also override the Fetcher outright via its own Fetcher field.
+	Fetchers map[string]Fetcher
+
+	clientOnce   sync.Once
+	eventsOnce   sync.Once
+	storeOnce    sync.Once
+	storeErr     error
+	fetchersOnce sync.Once
+	transferOnce sync.Once
+	defaultFetch map[string]Fetcher
+	events       *relay[Event]
+	transfer     *TransferManager
 }
 
 // ImageDownloadResult represents the result of a single image download
@@ -33,6 +102,12 @@ type ImageDetails struct {
 	URL      string
 	SubDir   string
 	FileName string
+
+	// Fetcher, if set, overrides scheme-based Fetcher resolution for this
+	// image. Useful for sources that can't be identified by URL scheme alone,
+	// e.g. RedditGalleryFetcher resolving a post URL to its underlying CDN
+	// image.
+	Fetcher Fetcher
 }
 
 // NewImageDownloader creates a new ImageDownloader instance
@@ -43,76 +118,343 @@ func NewImageDownloader(destFolder string, concurrency int) *ImageDownloader {
 	return &ImageDownloader{
 		DestinationFolder: destFolder,
 		Concurrency:       concurrency,
+		MaxRetries:        3,
+		BaseBackoff:       500 * time.Millisecond,
+		MaxBackoff:        30 * time.Second,
 	}
 }
 
 // DownloadImages downloads images from the given URLs and saves them to the destination folder
 func (id *ImageDownloader) DownloadImages(images []ImageDetails) []ImageDownloadResult {
+	return id.DownloadImagesContext(context.Background(), images)
+}
+
+// DownloadImagesContext downloads images from the given URLs and saves them to the
+// destination folder, returning early for this call's results as soon as ctx
+// is cancelled. Concurrent requests for the same URL, whether from this call
+// or another call on the same ImageDownloader, share one in-flight download
+// instead of fetching it twice; that shared download itself keeps running
+// for any other caller still waiting on it until the last one gives up, so
+// one caller's ctx cancelling doesn't abort a download others are still
+// watching. See TransferManager.
+func (id *ImageDownloader) DownloadImagesContext(ctx context.Context, images []ImageDetails) []ImageDownloadResult {
+	tm := id.transferManager()
+	watchers := make([]*Watcher, len(images))
+	for i, details := range images {
+		watchers[i] = tm.Download(details)
+	}
+
 	results := make([]ImageDownloadResult, len(images))
-	semaphore := make(chan struct{}, id.Concurrency)
+	for i, w := range watchers {
+		results[i] = w.Wait(ctx)
+		w.Release()
+	}
+	return results
+}
+
+// Results downloads images from the given URLs and streams back each
+// ImageDownloadResult on the returned channel as soon as it's ready, rather
+// than waiting for every download to finish. The channel is closed once all
+// downloads complete. As with DownloadImagesContext, concurrent requests for
+// the same URL share one in-flight download via TransferManager, and one
+// caller's ctx cancelling only affects that caller's own result.
+func (id *ImageDownloader) Results(ctx context.Context, images []ImageDetails) <-chan ImageDownloadResult {
+	tm := id.transferManager()
+	out := make(chan ImageDownloadResult, len(images))
 	var wg sync.WaitGroup
 
-	for i, image := range images {
+	for _, image := range images {
 		wg.Add(1)
-		go func(i int, details ImageDetails) {
+		go func(details ImageDetails) {
 			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			filePath, err := id.downloadSingleImage(details)
-			w, h, err := getImageDimensions(filePath)
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(69)
+			w := tm.Download(details)
+			defer w.Release()
+			out <- w.Wait(ctx)
+		}(image)
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out
+}
+
+// transferManager returns the ImageDownloader's shared TransferManager,
+// building it lazily so every caller of DownloadImagesContext/Results
+// dedups against the same set of in-flight transfers.
+func (id *ImageDownloader) transferManager() *TransferManager {
+	id.transferOnce.Do(func() {
+		concurrency := id.Concurrency
+		if concurrency <= 0 {
+			concurrency = 1
+		}
+		id.transfer = NewTransferManager(id, concurrency, concurrency)
+	})
+	return id.transfer
+}
+
+// downloadAndMeasure downloads a single image and, on success, decodes its
+// dimensions, preserving both the download error and the dimension-decode
+// error instead of letting one shadow the other. writeSem is passed through
+// to downloadSingleImage.
+func (id *ImageDownloader) downloadAndMeasure(ctx context.Context, details ImageDetails, writeSem chan struct{}) ImageDownloadResult {
+	filePath, downloadErr := id.downloadSingleImage(ctx, details, writeSem)
+
+	var w, h int
+	var dimErr error
+	if downloadErr == nil {
+		if id.ProgressOutput != nil {
+			id.ProgressOutput.WriteProgress(progress.Progress{ID: details.URL, Action: "Verifying"})
+		}
+		w, h, dimErr = getImageDimensions(filePath)
+		if dimErr == nil {
+			if store, err := id.store(); err == nil {
+				store.recordDimensions(details.URL, w, h)
 			}
-			results[i] = ImageDownloadResult{
-				URL:      details.URL,
-				FilePath: filePath,
-				Error:    err,
-				Width:    w,
-				Height:   h,
+			if id.ProgressOutput != nil {
+				id.ProgressOutput.WriteProgress(progress.Progress{ID: details.URL, Action: "Complete"})
 			}
-		}(i, image)
+		}
 	}
 
-	wg.Wait()
-	return results
+	return ImageDownloadResult{
+		URL:      details.URL,
+		FilePath: filePath,
+		Error:    errors.Join(downloadErr, dimErr),
+		Width:    w,
+		Height:   h,
+	}
 }
 
-// downloadSingleImage downloads a single image from the given URL and saves it to the destination folder
-func (id *ImageDownloader) downloadSingleImage(details ImageDetails) (string, error) {
-	client := &http.Client{}
+// downloadSingleImage downloads a single image from the given URL and saves it to the
+// destination folder, retrying transient failures with exponential backoff and jitter
+// until ctx is done or MaxRetries is exhausted. writeSem, if non-nil, is acquired for
+// the duration of the disk write so callers can cap concurrent writes independently
+// of concurrent connections.
+func (id *ImageDownloader) downloadSingleImage(ctx context.Context, details ImageDetails, writeSem chan struct{}) (string, error) {
+	id.emit(Event{Type: EventStarted, URL: details.URL})
 
-	resp, err := client.Get(details.URL)
-	if err != nil {
-		return "", fmt.Errorf("error downloading image: %v", err)
+	var lastErr error
+	for attempt := 0; attempt <= id.MaxRetries; attempt++ {
+		if attempt > 0 {
+			id.emit(Event{Type: EventRetrying, URL: details.URL, Attempt: attempt, Err: lastErr})
+			delay := id.backoffDelay(attempt, lastErr)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				id.emit(Event{Type: EventFailed, URL: details.URL, Err: ctx.Err()})
+				return "", ctx.Err()
+			}
+		}
+
+		filePath, retryable, err := id.attemptDownload(ctx, details, writeSem)
+		if err == nil {
+			id.emit(Event{Type: EventCompleted, URL: details.URL, Result: ImageDownloadResult{URL: details.URL, FilePath: filePath}})
+			return filePath, nil
+		}
+		lastErr = err
+		if !retryable {
+			id.emit(Event{Type: EventFailed, URL: details.URL, Err: err})
+			return "", err
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	err := fmt.Errorf("error downloading image after %d attempts: %v", id.MaxRetries+1, lastErr)
+	id.emit(Event{Type: EventFailed, URL: details.URL, Err: err})
+	return "", err
+}
+
+// attemptDownload makes a single fetch-and-save attempt. The returned bool reports
+// whether the error, if any, is transient and worth retrying.
+func (id *ImageDownloader) attemptDownload(ctx context.Context, details ImageDetails, writeSem chan struct{}) (string, bool, error) {
+	store, err := id.store()
+	if err != nil {
+		return "", false, fmt.Errorf("error opening store: %v", err)
 	}
 
-	dirPath := filepath.Join(id.DestinationFolder, details.SubDir)
-	filePath := filepath.Join(dirPath, details.FileName)
+	linkPath := filepath.Join(id.DestinationFolder, details.SubDir, details.FileName)
+
+	if info, ok := store.Lookup(details.URL); ok {
+		if err := linkBlob(blobPath(id.DestinationFolder, info.Digest), linkPath); err == nil {
+			return linkPath, false, nil
+		}
+		// The recorded blob is gone; fall through and re-download it.
+	}
 
-	err = os.MkdirAll(dirPath, 0764)
+	fetcher, err := id.fetcherFor(details)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(99)
+		return "", false, err
 	}
-	out, err := os.Create(filePath)
+
+	body, header, err := fetcher.Fetch(ctx, details)
 	if err != nil {
-		return "", fmt.Errorf("error creating file: %v", err)
+		return "", isFetchRetryable(err), err
+	}
+	defer body.Close()
+
+	blobsDir := filepath.Join(id.DestinationFolder, "blobs", "sha256")
+	if err := os.MkdirAll(blobsDir, 0764); err != nil {
+		return "", false, fmt.Errorf("error creating blob store: %v", err)
+	}
+
+	if writeSem != nil {
+		writeSem <- struct{}{}
+		defer func() { <-writeSem }()
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	tmp, err := os.CreateTemp(blobsDir, "download-*.tmp")
 	if err != nil {
-		return "", fmt.Errorf("error saving image: %v", err)
+		return "", false, fmt.Errorf("error creating temp file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once the temp file has been renamed away
+
+	var size int64
+	if cl := header.Get("Content-Length"); cl != "" {
+		size, _ = strconv.ParseInt(cl, 10, 64)
+	}
+	progressBody := progress.NewProgressReader(body, fanOutProgress{id.ProgressOutput, eventProgress{id, details.URL}}, size, details.URL, "Downloading")
+
+	hasher := sha256.New()
+	_, copyErr := io.Copy(tmp, io.TeeReader(progressBody, hasher))
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		if ctx.Err() != nil {
+			return "", false, ctx.Err()
+		}
+		return "", true, fmt.Errorf("error saving image: %v", copyErr)
+	}
+	if closeErr != nil {
+		return "", false, fmt.Errorf("error saving image: %v", closeErr)
+	}
+
+	digest := hex.EncodeToString(hasher.Sum(nil))
+	dest := blobPath(id.DestinationFolder, digest)
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0764); err != nil {
+		return "", false, fmt.Errorf("error creating blob store: %v", err)
+	}
+	if _, err := os.Stat(dest); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(tmpPath, dest); err != nil {
+			return "", false, fmt.Errorf("error storing blob: %v", err)
+		}
+	} else {
+		// Identical content is already stored under this digest; drop the duplicate.
+		os.Remove(tmpPath)
 	}
 
-	return filePath, nil
+	if err := linkBlob(dest, linkPath); err != nil {
+		return "", false, err
+	}
+	if err := store.record(details.URL, digest); err != nil {
+		return "", false, fmt.Errorf("error updating store: %v", err)
+	}
+
+	return linkPath, false, nil
+}
+
+// store returns the ImageDownloader's metadata Store, opening it from
+// "metadata.json" in DestinationFolder on first use.
+func (id *ImageDownloader) store() (*Store, error) {
+	id.storeOnce.Do(func() {
+		if id.Store != nil {
+			return
+		}
+		id.Store, id.storeErr = loadStore(filepath.Join(id.DestinationFolder, "metadata.json"))
+	})
+	return id.Store, id.storeErr
+}
+
+// httpClient returns the ImageDownloader's shared *http.Client, building a
+// sensibly-configured default on first use so connections are pooled across
+// every download instead of dialed fresh each time.
+func (id *ImageDownloader) httpClient() *http.Client {
+	id.clientOnce.Do(func() {
+		if id.HTTPClient != nil {
+			return
+		}
+
+		dialTimeout := id.DialTimeout
+		if dialTimeout <= 0 {
+			dialTimeout = 30 * time.Second
+		}
+		maxIdle := id.MaxIdleConnsPerHost
+		if maxIdle <= 0 {
+			maxIdle = 10
+		}
+
+		id.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				DialContext:         (&net.Dialer{Timeout: dialTimeout}).DialContext,
+				MaxIdleConnsPerHost: maxIdle,
+			},
+		}
+	})
+	return id.HTTPClient
+}
+
+func (id *ImageDownloader) isRetryableStatus(status int) bool {
+	statuses := id.RetryableStatus
+	if statuses == nil {
+		statuses = defaultRetryableStatus
+	}
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoffDelay computes the delay before the next retry attempt, honoring a
+// Retry-After header on lastErr when present.
+func (id *ImageDownloader) backoffDelay(attempt int, lastErr error) time.Duration {
+	var raErr retryAfterError
+	if errors.As(lastErr, &raErr) {
+		if d, ok := raErr.delay(); ok {
+			return d
+		}
+	}
+
+	base := id.BaseBackoff
+	if base <= 0 {
+		base = 500 * time.Millisecond
+	}
+	maxBackoff := id.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 30 * time.Second
+	}
+
+	delay := base << uint(attempt-1)
+	if delay <= 0 || delay > maxBackoff {
+		delay = maxBackoff
+	}
+	jitter := time.Duration(rand.Int63n(int64(delay) + 1))
+	return (delay + jitter) / 2
+}
+
+// retryAfterError wraps a transient error that may carry a Retry-After header.
+type retryAfterError struct {
+	err    error
+	header string
+}
+
+func (e retryAfterError) Error() string { return e.err.Error() }
+func (e retryAfterError) Unwrap() error { return e.err }
+
+func (e retryAfterError) delay() (time.Duration, bool) {
+	if e.header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(e.header); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(e.header); err == nil {
+		return time.Until(when), true
+	}
+	return 0, false
 }
 
 func getImageDimensions(filename string) (int, int, error) {
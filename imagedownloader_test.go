@@ -0,0 +1,78 @@
+package imagedownloader
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfterErrorDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		wantOK  bool
+		wantMin time.Duration
+		wantMax time.Duration
+	}{
+		{name: "empty header", header: "", wantOK: false},
+		{name: "seconds", header: "5", wantOK: true, wantMin: 5 * time.Second, wantMax: 5 * time.Second},
+		{name: "http date", header: time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), wantOK: true, wantMin: 9 * time.Second, wantMax: 10 * time.Second},
+		{name: "garbage", header: "not-a-value", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := retryAfterError{err: fmt.Errorf("boom"), header: tt.header}
+			d, ok := e.delay()
+			if ok != tt.wantOK {
+				t.Fatalf("delay() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (d < tt.wantMin || d > tt.wantMax) {
+				t.Fatalf("delay() = %v, want between %v and %v", d, tt.wantMin, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestBackoffDelayDoublesAndCaps(t *testing.T) {
+	id := &ImageDownloader{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := id.backoffDelay(attempt, fmt.Errorf("transient"))
+		if d > id.MaxBackoff {
+			t.Fatalf("attempt %d: delay %v exceeds MaxBackoff %v", attempt, d, id.MaxBackoff)
+		}
+		if d < 0 {
+			t.Fatalf("attempt %d: negative delay %v", attempt, d)
+		}
+
+		// Jitter picks a delay between half and all of BaseBackoff doubled
+		// (attempt-1) times, capped at MaxBackoff.
+		want := id.BaseBackoff << uint(attempt-1)
+		if want > id.MaxBackoff {
+			want = id.MaxBackoff
+		}
+		if d < want/2 || d > want {
+			t.Fatalf("attempt %d: delay %v, want between %v and %v", attempt, d, want/2, want)
+		}
+	}
+}
+
+func TestBackoffDelayHonorsRetryAfter(t *testing.T) {
+	id := &ImageDownloader{BaseBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	err := retryAfterError{err: fmt.Errorf("rate limited"), header: "2"}
+
+	d := id.backoffDelay(1, err)
+	if d != 2*time.Second {
+		t.Fatalf("backoffDelay() = %v, want 2s honoring Retry-After", d)
+	}
+}
+
+func TestBackoffDelayDefaultsWhenUnset(t *testing.T) {
+	id := &ImageDownloader{}
+	d := id.backoffDelay(1, fmt.Errorf("transient"))
+	if d <= 0 || d > 30*time.Second {
+		t.Fatalf("backoffDelay() = %v, want within default bounds", d)
+	}
+}
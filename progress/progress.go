@@ -0,0 +1,109 @@
+// Package progress provides a pluggable way for callers to observe the
+// progress of a download, modeled on Docker's pkg/progress.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Progress is a point-in-time status update for a single unit of work, e.g.
+// the download of one image.
+type Progress struct {
+	ID      string `json:"id"`
+	Action  string `json:"action"`
+	Current int64  `json:"current"`
+	Total   int64  `json:"total,omitempty"`
+}
+
+// ProgressOutput is notified of Progress updates as they happen.
+type ProgressOutput interface {
+	WriteProgress(Progress) error
+}
+
+// reader wraps an io.Reader and reports bytes read to a ProgressOutput.
+type reader struct {
+	io.Reader
+	out     ProgressOutput
+	id      string
+	action  string
+	current int64
+	total   int64
+}
+
+// NewProgressReader wraps r so that every Read that returns data reports
+// progress to out; a Read that returns no bytes reports nothing. size
+// is the expected total number of bytes, or 0 if unknown (e.g. no
+// Content-Length). id identifies the unit of work (e.g. a URL) and action
+// describes what's happening to it (e.g. "Downloading").
+func NewProgressReader(r io.Reader, out ProgressOutput, size int64, id, action string) io.ReadCloser {
+	return &reader{Reader: r, out: out, id: id, action: action, total: size}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.current += int64(n)
+		r.out.WriteProgress(Progress{ID: r.id, Action: r.action, Current: r.current, Total: r.total})
+	}
+	return n, err
+}
+
+func (r *reader) Close() error {
+	if closer, ok := r.Reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// JSONOutput writes each Progress update as a JSON object, one per line.
+type JSONOutput struct {
+	w io.Writer
+}
+
+// NewJSONOutput creates a ProgressOutput that writes JSON lines to w.
+func NewJSONOutput(w io.Writer) *JSONOutput {
+	return &JSONOutput{w: w}
+}
+
+func (o *JSONOutput) WriteProgress(p Progress) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(o.w, string(b))
+	return err
+}
+
+// HumanOutput writes each Progress update as a human-readable line to w.
+type HumanOutput struct {
+	w io.Writer
+}
+
+// NewHumanOutput creates a ProgressOutput that writes human-readable lines to w.
+func NewHumanOutput(w io.Writer) *HumanOutput {
+	return &HumanOutput{w: w}
+}
+
+func (o *HumanOutput) WriteProgress(p Progress) error {
+	if p.Total > 0 {
+		_, err := fmt.Fprintf(o.w, "%s: %s %s/%s\n", p.ID, p.Action, formatBytes(p.Current), formatBytes(p.Total))
+		return err
+	}
+	_, err := fmt.Fprintf(o.w, "%s: %s %s\n", p.ID, p.Action, formatBytes(p.Current))
+	return err
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,104 @@
+package progress
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+type recordingOutput struct {
+	updates []Progress
+}
+
+func (r *recordingOutput) WriteProgress(p Progress) error {
+	r.updates = append(r.updates, p)
+	return nil
+}
+
+func TestNewProgressReaderReportsBytesAndTotal(t *testing.T) {
+	const body = "hello, world! this is some test data."
+	out := &recordingOutput{}
+	r := NewProgressReader(strings.NewReader(body), out, int64(len(body)), "url-1", "Downloading")
+	defer r.Close()
+
+	buf := make([]byte, 8)
+	var total int64
+	for {
+		n, err := r.Read(buf)
+		total += int64(n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if total != int64(len(body)) {
+		t.Fatalf("read %d bytes, want %d", total, len(body))
+	}
+	if len(out.updates) == 0 {
+		t.Fatal("expected at least one progress update")
+	}
+
+	last := out.updates[len(out.updates)-1]
+	if last.Current != int64(len(body)) {
+		t.Errorf("last update Current = %d, want %d", last.Current, len(body))
+	}
+	if last.Total != int64(len(body)) {
+		t.Errorf("last update Total = %d, want %d", last.Total, len(body))
+	}
+	if last.ID != "url-1" || last.Action != "Downloading" {
+		t.Errorf("last update ID/Action = %q/%q, want %q/%q", last.ID, last.Action, "url-1", "Downloading")
+	}
+
+	for i, u := range out.updates {
+		if u.Current <= 0 {
+			t.Errorf("update %d: Current = %d, want > 0", i, u.Current)
+		}
+		if u.Current > int64(len(body)) {
+			t.Errorf("update %d: Current = %d exceeds body length %d", i, u.Current, len(body))
+		}
+	}
+}
+
+func TestNewProgressReaderZeroTotalWhenSizeUnknown(t *testing.T) {
+	out := &recordingOutput{}
+	r := NewProgressReader(strings.NewReader("abc"), out, 0, "url-2", "Downloading")
+	defer r.Close()
+
+	if _, err := io.ReadAll(r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(out.updates) == 0 {
+		t.Fatal("expected at least one progress update")
+	}
+	for i, u := range out.updates {
+		if u.Total != 0 {
+			t.Errorf("update %d: Total = %d, want 0 when size is unknown", i, u.Total)
+		}
+	}
+}
+
+type errCloser struct {
+	io.Reader
+	closed bool
+}
+
+func (c *errCloser) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestProgressReaderCloseDelegatesToUnderlyingCloser(t *testing.T) {
+	underlying := &errCloser{Reader: strings.NewReader("x")}
+	r := NewProgressReader(underlying, &recordingOutput{}, 1, "url-3", "Downloading")
+
+	if err := r.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !underlying.closed {
+		t.Fatal("expected underlying Closer to be closed")
+	}
+}
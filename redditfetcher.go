@@ -0,0 +1,180 @@
+package imagedownloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedditGalleryFetcher resolves a Reddit post URL (e.g.
+// "https://www.reddit.com/r/pics/comments/abc123/title/") to its underlying
+// CDN image URL via Reddit's JSON API, then fetches that URL instead. Set it
+// as an ImageDetails.Fetcher override for post URLs that aren't already
+// direct image links; scheme-based dispatch can't distinguish a gallery post
+// from a plain https image. Modeled on the gallery resolution step in the
+// Redmage project.
+type RedditGalleryFetcher struct {
+	// HTTPClient is used for both the API lookup and the final image fetch.
+	// Built lazily with sane defaults if left nil.
+	HTTPClient *http.Client
+
+	clientOnce sync.Once
+}
+
+func (f *RedditGalleryFetcher) Fetch(ctx context.Context, details ImageDetails) (io.ReadCloser, http.Header, error) {
+	imageURL, err := f.resolve(ctx, details.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error building request: %v", err)
+	}
+
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, nil, &fetchError{err: fmt.Errorf("error downloading image: %v", err), retryable: true}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, nil, &fetchError{
+			err:       fmt.Errorf("unexpected status code fetching %s: %d", imageURL, resp.StatusCode),
+			retryable: isRedditRetryableStatus(resp.StatusCode),
+		}
+	}
+	return resp.Body, resp.Header, nil
+}
+
+// resolve looks up postURL via Reddit's JSON API and returns the underlying
+// image URL: the gallery's first resolvable image, the post's preview image,
+// or else the post's link URL, which is returned without checking that it
+// points at an image.
+func (f *RedditGalleryFetcher) resolve(ctx context.Context, postURL string) (string, error) {
+	apiURL, err := redditJSONURL(postURL)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("error building request: %v", err)
+	}
+	req.Header.Set("User-Agent", "imagedownloader/1.0")
+
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return "", &fetchError{err: fmt.Errorf("error resolving reddit post: %v", err), retryable: true}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &fetchError{
+			err:       fmt.Errorf("unexpected status code resolving %s: %d", postURL, resp.StatusCode),
+			retryable: isRedditRetryableStatus(resp.StatusCode),
+		}
+	}
+
+	var listing []redditListing
+	if err := json.NewDecoder(resp.Body).Decode(&listing); err != nil {
+		return "", fmt.Errorf("error parsing reddit response: %v", err)
+	}
+	if len(listing) == 0 || len(listing[0].Data.Children) == 0 {
+		return "", fmt.Errorf("no post found at %s", postURL)
+	}
+
+	post := listing[0].Data.Children[0].Data
+
+	if post.IsGallery {
+		for _, item := range post.GalleryData.Items {
+			if media, ok := post.MediaMetadata[item.MediaID]; ok && media.Source.URL != "" {
+				return unescapeRedditURL(media.Source.URL), nil
+			}
+		}
+		return "", fmt.Errorf("gallery post %s has no resolvable media", postURL)
+	}
+
+	if len(post.Preview.Images) > 0 && post.Preview.Images[0].Source.URL != "" {
+		return unescapeRedditURL(post.Preview.Images[0].Source.URL), nil
+	}
+
+	if post.URLOverriddenByDest != "" {
+		return post.URLOverriddenByDest, nil
+	}
+
+	return "", fmt.Errorf("post %s does not resolve to an image", postURL)
+}
+
+func (f *RedditGalleryFetcher) client() *http.Client {
+	f.clientOnce.Do(func() {
+		if f.HTTPClient == nil {
+			f.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+		}
+	})
+	return f.HTTPClient
+}
+
+// isRedditRetryableStatus reports whether a status code from Reddit's API or
+// CDN is worth retrying.
+func isRedditRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// redditJSONURL rewrites a Reddit post URL, which may carry a trailing slash
+// and/or a tracking query string (e.g. from a mobile share link), into its
+// JSON API equivalent by appending ".json" to the path and dropping the
+// query.
+func redditJSONURL(postURL string) (string, error) {
+	u, err := url.Parse(postURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing reddit url: %v", err)
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + ".json"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// unescapeRedditURL undoes the HTML entity escaping Reddit applies to image
+// URLs in its JSON API responses (e.g. "&amp;" becomes "&").
+func unescapeRedditURL(raw string) string {
+	return html.UnescapeString(raw)
+}
+
+// redditListing mirrors the subset of Reddit's JSON API response used to
+// resolve a post to its image(s).
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	IsGallery           bool   `json:"is_gallery"`
+	URLOverriddenByDest string `json:"url_overridden_by_dest"`
+	GalleryData         struct {
+		Items []struct {
+			MediaID string `json:"media_id"`
+		} `json:"items"`
+	} `json:"gallery_data"`
+	MediaMetadata map[string]struct {
+		Source struct {
+			URL string `json:"u"`
+		} `json:"s"`
+	} `json:"media_metadata"`
+	Preview struct {
+		Images []struct {
+			Source struct {
+				URL string `json:"url"`
+			} `json:"source"`
+		} `json:"images"`
+	} `json:"preview"`
+}
@@ -0,0 +1,59 @@
+package imagedownloader
+
+import "testing"
+
+func TestRedditJSONURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		postURL string
+		want    string
+	}{
+		{
+			name:    "trailing slash",
+			postURL: "https://www.reddit.com/r/pics/comments/abc123/title/",
+			want:    "https://www.reddit.com/r/pics/comments/abc123/title.json",
+		},
+		{
+			name:    "no trailing slash",
+			postURL: "https://www.reddit.com/r/pics/comments/abc123/title",
+			want:    "https://www.reddit.com/r/pics/comments/abc123/title.json",
+		},
+		{
+			name:    "share link with tracking query string",
+			postURL: "https://www.reddit.com/r/pics/comments/abc123/title/?utm_source=share&utm_medium=ios_app&utm_name=iossmf",
+			want:    "https://www.reddit.com/r/pics/comments/abc123/title.json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := redditJSONURL(tt.postURL)
+			if err != nil {
+				t.Fatalf("redditJSONURL(%q) unexpected error: %v", tt.postURL, err)
+			}
+			if got != tt.want {
+				t.Errorf("redditJSONURL(%q) = %q, want %q", tt.postURL, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnescapeRedditURL(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want string
+	}{
+		{name: "ampersand entity", raw: "https://i.redd.it/x.jpg?a=1&amp;b=2", want: "https://i.redd.it/x.jpg?a=1&b=2"},
+		{name: "apostrophe entity", raw: "https://i.redd.it/it&#39;s.jpg", want: "https://i.redd.it/it's.jpg"},
+		{name: "no entities", raw: "https://i.redd.it/x.jpg", want: "https://i.redd.it/x.jpg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unescapeRedditURL(tt.raw); got != tt.want {
+				t.Errorf("unescapeRedditURL(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
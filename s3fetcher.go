@@ -0,0 +1,97 @@
+package imagedownloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// S3Fetcher fetches images stored in S3 via "s3://bucket/key" URLs. Client,
+// if set, is used as-is; otherwise one is built lazily from the default AWS
+// config chain (environment, shared config file, IAM role, etc.).
+type S3Fetcher struct {
+	Client *s3.Client
+
+	clientOnce sync.Once
+	clientErr  error
+}
+
+func (f *S3Fetcher) Fetch(ctx context.Context, details ImageDetails) (io.ReadCloser, http.Header, error) {
+	bucket, key, err := parseS3URL(details.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := f.client(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, nil, &fetchError{err: fmt.Errorf("error fetching s3 object: %v", err), retryable: isS3Retryable(err)}
+	}
+
+	header := http.Header{}
+	if out.ContentType != nil {
+		header.Set("Content-Type", *out.ContentType)
+	}
+	if out.ContentLength != nil {
+		header.Set("Content-Length", strconv.FormatInt(*out.ContentLength, 10))
+	}
+	return out.Body, header, nil
+}
+
+// client returns f's S3 client, building one from the default AWS config
+// chain on first use if Client wasn't set.
+func (f *S3Fetcher) client(ctx context.Context) (*s3.Client, error) {
+	f.clientOnce.Do(func() {
+		if f.Client != nil {
+			return
+		}
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			f.clientErr = fmt.Errorf("error loading aws config: %v", err)
+			return
+		}
+		f.Client = s3.NewFromConfig(cfg)
+	})
+	return f.Client, f.clientErr
+}
+
+// isS3Retryable reports whether a GetObject error is worth retrying,
+// treating errors like a missing key or denied access as terminal rather than
+// transient.
+func isS3Retryable(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NoSuchBucket", "AccessDenied":
+			return false
+		}
+	}
+	return true
+}
+
+// parseS3URL splits an "s3://bucket/key" URL into its bucket and key.
+func parseS3URL(rawURL string) (bucket, key string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", fmt.Errorf("error parsing s3 url: %v", err)
+	}
+	if u.Scheme != "s3" {
+		return "", "", fmt.Errorf("not an s3 url: %s", rawURL)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
@@ -0,0 +1,147 @@
+package imagedownloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BlobInfo records what's known about one downloaded blob, keyed by its
+// content digest.
+type BlobInfo struct {
+	Digest  string    `json:"digest"`
+	Width   int       `json:"width"`
+	Height  int       `json:"height"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Store is a small JSON-backed metadata store mapping a source URL to the
+// content digest it downloaded to, so re-downloading the same URL becomes a
+// no-op and identical images fetched from different URLs share one blob.
+type Store struct {
+	path string
+
+	mu    sync.Mutex
+	ByURL map[string]string   `json:"byURL"`
+	Blobs map[string]BlobInfo `json:"blobs"`
+}
+
+// loadStore reads the metadata store from path, returning an empty store if
+// it doesn't exist yet.
+func loadStore(path string) (*Store, error) {
+	s := &Store{path: path, ByURL: make(map[string]string), Blobs: make(map[string]BlobInfo)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading store: %v", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("error parsing store: %v", err)
+	}
+	return s, nil
+}
+
+// Lookup returns what the store knows about url, if it's been downloaded before.
+func (s *Store) Lookup(url string) (BlobInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digest, ok := s.ByURL[url]
+	if !ok {
+		return BlobInfo{}, false
+	}
+	info, ok := s.Blobs[digest]
+	return info, ok
+}
+
+// record associates url with digest and persists the store to disk.
+func (s *Store) record(url, digest string) error {
+	s.mu.Lock()
+	s.ByURL[url] = digest
+	if _, ok := s.Blobs[digest]; !ok {
+		s.Blobs[digest] = BlobInfo{Digest: digest, ModTime: time.Now()}
+	}
+	s.mu.Unlock()
+	return s.save()
+}
+
+// recordDimensions fills in the decoded width/height for the blob url
+// resolved to, if any.
+func (s *Store) recordDimensions(url string, width, height int) error {
+	s.mu.Lock()
+	digest, ok := s.ByURL[url]
+	if !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	info := s.Blobs[digest]
+	info.Width, info.Height = width, height
+	s.Blobs[digest] = info
+	s.mu.Unlock()
+	return s.save()
+}
+
+// save writes the store to disk via a unique temp file followed by an atomic
+// rename, holding mu for the entire marshal-write-rename sequence. Concurrent
+// callers (record and recordDimensions are called from every in-flight
+// download) therefore neither race over a shared temp path nor clobber each
+// other's update with a stale snapshot.
+func (s *Store) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding store: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // no-op once the temp file has been renamed away
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing store: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing store: %v", err)
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("error saving store: %v", err)
+	}
+	return nil
+}
+
+// blobPath returns the content-addressed path for a sha256 digest under root,
+// e.g. "<root>/blobs/sha256/ab/abcdef...".
+func blobPath(root, digest string) string {
+	return filepath.Join(root, "blobs", "sha256", digest[:2], digest)
+}
+
+// linkBlob makes link point at blob, preferring a hardlink and falling back
+// to a symlink (e.g. across devices). Any existing file at link is replaced.
+func linkBlob(blob, link string) error {
+	if err := os.MkdirAll(filepath.Dir(link), 0764); err != nil {
+		return fmt.Errorf("error creating destination folder: %v", err)
+	}
+	if err := os.Remove(link); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error replacing existing file: %v", err)
+	}
+	if err := os.Link(blob, link); err == nil {
+		return nil
+	}
+	if err := os.Symlink(blob, link); err != nil {
+		return fmt.Errorf("error linking blob: %v", err)
+	}
+	return nil
+}
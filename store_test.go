@@ -0,0 +1,90 @@
+package imagedownloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestBlobPath(t *testing.T) {
+	digest := "abcdef0123456789"
+	got := blobPath("/root", digest)
+	want := filepath.Join("/root", "blobs", "sha256", "ab", digest)
+	if got != want {
+		t.Fatalf("blobPath() = %q, want %q", got, want)
+	}
+}
+
+func TestLinkBlobHardlinksAndReplacesExisting(t *testing.T) {
+	dir := t.TempDir()
+	blob := filepath.Join(dir, "blob")
+	if err := os.WriteFile(blob, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	link := filepath.Join(dir, "nested", "image.jpg")
+	if err := linkBlob(blob, link); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content" {
+		t.Fatalf("link contents = %q, want %q", data, "content")
+	}
+
+	// Linking again over an existing file at link should replace it rather
+	// than fail.
+	if err := os.WriteFile(blob, []byte("updated"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkBlob(blob, link); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "updated" {
+		t.Fatalf("link contents after relink = %q, want %q", data, "updated")
+	}
+}
+
+func TestStoreConcurrentRecordDoesNotRace(t *testing.T) {
+	dir := t.TempDir()
+	s, err := loadStore(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.record(fmt.Sprintf("url-%d", i), fmt.Sprintf("digest-%d", i)); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("concurrent record() failed: %v", err)
+	}
+
+	reloaded, err := loadStore(filepath.Join(dir, "metadata.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.ByURL) != n {
+		t.Fatalf("reloaded store has %d entries, want %d", len(reloaded.ByURL), n)
+	}
+}
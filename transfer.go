@@ -0,0 +1,181 @@
+package imagedownloader
+
+import (
+	"context"
+	"sync"
+)
+
+// transferState represents the lifecycle of a Transfer.
+type transferState int
+
+const (
+	transferQueued transferState = iota
+	transferRunning
+	transferDone
+	transferFailed
+)
+
+// Transfer tracks a single in-flight (or completed) download of one URL so that
+// concurrent requests for the same URL share one download instead of fetching
+// it twice. Modeled on the transfer type in Docker's distribution/xfer package.
+type Transfer struct {
+	url string
+
+	mu       sync.Mutex
+	state    transferState
+	cancel   context.CancelFunc
+	done     chan struct{}
+	result   ImageDownloadResult
+	watchers map[int]struct{}
+	nextID   int
+}
+
+func newTransfer(url string) *Transfer {
+	return &Transfer{
+		url:      url,
+		state:    transferQueued,
+		done:     make(chan struct{}),
+		watchers: make(map[int]struct{}),
+	}
+}
+
+// watch registers a new Watcher on the transfer.
+func (t *Transfer) watch() *Watcher {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	id := t.nextID
+	t.nextID++
+	t.watchers[id] = struct{}{}
+	return &Watcher{id: id, transfer: t}
+}
+
+// releaseWatcher drops a Watcher. If it was the last one and the transfer
+// hasn't finished yet, the transfer is cancelled.
+func (t *Transfer) releaseWatcher(id int) {
+	t.mu.Lock()
+	delete(t.watchers, id)
+	empty := len(t.watchers) == 0
+	cancel := t.cancel
+	running := t.state == transferQueued || t.state == transferRunning
+	t.mu.Unlock()
+
+	if empty && running && cancel != nil {
+		cancel()
+	}
+}
+
+// finish records the transfer's result and wakes every Watcher.
+func (t *Transfer) finish(result ImageDownloadResult) {
+	t.mu.Lock()
+	if result.Error != nil {
+		t.state = transferFailed
+	} else {
+		t.state = transferDone
+	}
+	t.result = result
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// Watcher observes a single Transfer. Multiple callers requesting the same URL
+// concurrently share one Transfer but each get their own Watcher so that one
+// caller giving up doesn't affect the others still waiting.
+type Watcher struct {
+	id       int
+	transfer *Transfer
+}
+
+// Wait blocks until the watched Transfer completes or ctx is done, whichever
+// comes first. A joining caller's own ctx expiring only unblocks that
+// caller's Wait; it doesn't cancel the underlying Transfer, which keeps
+// running for any other Watcher still waiting on it.
+func (w *Watcher) Wait(ctx context.Context) ImageDownloadResult {
+	select {
+	case <-w.transfer.done:
+		w.transfer.mu.Lock()
+		defer w.transfer.mu.Unlock()
+		return w.transfer.result
+	case <-ctx.Done():
+		return ImageDownloadResult{URL: w.transfer.url, Error: ctx.Err()}
+	}
+}
+
+// Release detaches the Watcher from its Transfer. Once the last Watcher for a
+// still-running Transfer is released, the Transfer is cancelled.
+func (w *Watcher) Release() {
+	w.transfer.releaseWatcher(w.id)
+}
+
+// TransferManager deduplicates concurrent downloads of the same URL and
+// enforces separate global concurrency limits for connections and disk
+// writes. Modeled on Docker's distribution/xfer transfer manager.
+type TransferManager struct {
+	downloader *ImageDownloader
+
+	mu        sync.Mutex
+	transfers map[string]*Transfer
+
+	connSemaphore  chan struct{}
+	writeSemaphore chan struct{}
+}
+
+// NewTransferManager creates a TransferManager that schedules downloads through
+// downloader, limiting concurrent connections and concurrent disk writes
+// independently.
+func NewTransferManager(downloader *ImageDownloader, maxConcurrentConns, maxConcurrentWrites int) *TransferManager {
+	if maxConcurrentConns <= 0 {
+		maxConcurrentConns = 1
+	}
+	if maxConcurrentWrites <= 0 {
+		maxConcurrentWrites = 1
+	}
+	return &TransferManager{
+		downloader:     downloader,
+		transfers:      make(map[string]*Transfer),
+		connSemaphore:  make(chan struct{}, maxConcurrentConns),
+		writeSemaphore: make(chan struct{}, maxConcurrentWrites),
+	}
+}
+
+// Download schedules details.URL for download, sharing an in-flight Transfer
+// with any other caller currently requesting the same URL. It returns a
+// Watcher the caller must Wait(ctx) on and Release() when done with it. The
+// Transfer itself runs on its own context independent of any one caller's;
+// it's only cancelled once every Watcher has been released, per the "last
+// watcher release cancels" model.
+func (tm *TransferManager) Download(details ImageDetails) *Watcher {
+	tm.mu.Lock()
+	t, ok := tm.transfers[details.URL]
+	if !ok {
+		t = newTransfer(details.URL)
+		tm.transfers[details.URL] = t
+		tm.mu.Unlock()
+		go tm.run(details, t)
+	} else {
+		tm.mu.Unlock()
+	}
+	return t.watch()
+}
+
+// run performs the download backing a freshly created Transfer and removes it
+// from the manager once it settles.
+func (tm *TransferManager) run(details ImageDetails, t *Transfer) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.mu.Lock()
+	t.state = transferRunning
+	t.cancel = cancel
+	t.mu.Unlock()
+
+	tm.connSemaphore <- struct{}{}
+	result := tm.downloader.downloadAndMeasure(ctx, details, tm.writeSemaphore)
+	<-tm.connSemaphore
+
+	tm.mu.Lock()
+	delete(tm.transfers, details.URL)
+	tm.mu.Unlock()
+
+	t.finish(result)
+}
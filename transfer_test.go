@@ -0,0 +1,122 @@
+package imagedownloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tiny1x1PNG is a minimal valid PNG so getImageDimensions succeeds without a
+// real test fixture on disk.
+var tiny1x1PNG = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d,
+	0x49, 0x48, 0x44, 0x52, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	0x08, 0x02, 0x00, 0x00, 0x00, 0x90, 0x77, 0x53, 0xde, 0x00, 0x00, 0x00,
+	0x0c, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0xf8, 0xcf, 0xc0, 0x00,
+	0x00, 0x03, 0x01, 0x01, 0x00, 0xc9, 0xfe, 0x92, 0xef, 0x00, 0x00, 0x00,
+	0x00, 0x49, 0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
+
+func TestJoiningWatcherReturnsOnOwnDeadline(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Write(tiny1x1PNG)
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	dir := t.TempDir()
+	id := NewImageDownloader(dir, 4)
+	details := ImageDetails{URL: srv.URL, SubDir: "a", FileName: "1.png"}
+
+	go id.DownloadImagesContext(context.Background(), []ImageDetails{details})
+	time.Sleep(50 * time.Millisecond) // let the first call create the Transfer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	results := id.DownloadImagesContext(ctx, []ImageDetails{details})
+	elapsed := time.Since(start)
+
+	if elapsed > 400*time.Millisecond {
+		t.Fatalf("joining caller took %v, want to return near its own 100ms deadline", elapsed)
+	}
+	if results[0].Error == nil {
+		t.Fatal("expected a deadline error for the joining caller, got nil")
+	}
+}
+
+func TestOriginatingWatcherCancelDoesNotAbortOthers(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		w.Write(tiny1x1PNG)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	id := NewImageDownloader(dir, 4)
+	details := ImageDetails{URL: srv.URL, SubDir: "a", FileName: "1.png"}
+
+	originatorCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go id.DownloadImagesContext(originatorCtx, []ImageDetails{details})
+	time.Sleep(5 * time.Millisecond) // let it create the Transfer first
+
+	joinerDone := make(chan []ImageDownloadResult, 1)
+	go func() {
+		joinerDone <- id.DownloadImagesContext(context.Background(), []ImageDetails{details})
+	}()
+
+	time.Sleep(100 * time.Millisecond) // let the originator's deadline pass well before it unblocks
+	close(unblock)
+
+	select {
+	case results := <-joinerDone:
+		if results[0].Error != nil {
+			t.Fatalf("joining caller (context.Background()) got an error from the originator's cancelled context: %v", results[0].Error)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("joining caller never returned")
+	}
+}
+
+func TestTransferManagerDedupesConcurrentSameURLDownloads(t *testing.T) {
+	var hits int
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits++
+		mu.Unlock()
+		w.Write(tiny1x1PNG)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	id := NewImageDownloader(dir, 4)
+	tm := id.transferManager()
+	details := ImageDetails{URL: srv.URL, SubDir: "a", FileName: "1.png"}
+
+	const n = 5
+	watchers := make([]*Watcher, n)
+	for i := range watchers {
+		watchers[i] = tm.Download(details)
+	}
+	for _, w := range watchers {
+		if result := w.Wait(context.Background()); result.Error != nil {
+			t.Fatalf("unexpected error: %v", result.Error)
+		}
+		w.Release()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits != 1 {
+		t.Fatalf("server saw %d requests for %d concurrent watchers on the same URL, want 1", hits, n)
+	}
+}